@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"syscall"
+)
+
+// memSemaphore is a counting semaphore over bytes rather than a fixed slot
+// count, since part sizes vary once dynamic sizing kicks in. A request
+// larger than the limit is still admitted once the pool is fully idle, so a
+// single oversized part can never deadlock the uploader.
+type memSemaphore struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int64
+	used  int64
+}
+
+func newMemSemaphore(limit int64) *memSemaphore {
+	s := &memSemaphore{limit: limit}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *memSemaphore) acquire(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.used > 0 && s.used+n > s.limit {
+		s.cond.Wait()
+	}
+	s.used += n
+}
+
+func (s *memSemaphore) release(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used -= n
+	s.cond.Broadcast()
+}
+
+// bufferPool hands out part-sized byte slices while keeping total in-flight
+// memory under a hard cap: get blocks the caller (the stdin reader) once
+// that cap is reached instead of letting sync.Pool grow without bound under
+// GC pressure. Buffers at the configured partSize are recycled through an
+// inner sync.Pool; any other size (a grown part in streaming mode) is
+// allocated directly and discarded on put. With useMmap, every buffer is
+// mmap'd on get and unmapped on put, and none are recycled.
+type bufferPool struct {
+	partSize int
+	useMmap  bool
+	sem      *memSemaphore
+	pool     sync.Pool
+}
+
+func newBufferPool(partSize int, maxMemoryBytes int64, useMmap bool) *bufferPool {
+	return &bufferPool{
+		partSize: partSize,
+		useMmap:  useMmap,
+		sem:      newMemSemaphore(maxMemoryBytes),
+		pool: sync.Pool{
+			New: func() interface{} {
+				buf := make([]byte, partSize)
+				return &buf
+			},
+		},
+	}
+}
+
+// get returns a buffer of exactly size bytes, blocking until the memory cap
+// allows it.
+func (p *bufferPool) get(size int) ([]byte, error) {
+	p.sem.acquire(int64(size))
+	if size == p.partSize && !p.useMmap {
+		bufPtr := p.pool.Get().(*[]byte)
+		return *bufPtr, nil
+	}
+	if p.useMmap {
+		return mmapAnon(size)
+	}
+	return make([]byte, size), nil
+}
+
+// put returns a buffer obtained from get, releasing its share of the memory
+// cap and unmapping or recycling the backing storage as appropriate.
+func (p *bufferPool) put(buf []byte) {
+	p.sem.release(int64(len(buf)))
+	if p.useMmap && len(buf) > 0 {
+		if err := munmapAnon(buf); err != nil {
+			log.Printf("Warning: failed to munmap buffer: %v", err)
+		}
+		return
+	}
+	if len(buf) == p.partSize {
+		p.pool.Put(&buf)
+	}
+}
+
+// mmapAnon backs a buffer with anonymous mmap'd pages instead of the Go
+// heap, so large parts don't inflate heap size or trigger extra GC cycles.
+func mmapAnon(size int) ([]byte, error) {
+	return syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+}
+
+func munmapAnon(buf []byte) error {
+	return syscall.Munmap(buf)
+}
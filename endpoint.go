@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// newS3Client builds an S3 client targeting AWS by default (dualstack
+// endpoint resolution), or an explicit endpoint when one is given via
+// --endpoint or the AWS_ENDPOINT_URL_S3 environment variable - which is how
+// this tool talks to S3-compatible providers like MinIO, R2, B2, or Wasabi.
+func newS3Client(ctx context.Context, region, endpoint string, pathStyle, disableSSL bool) (*s3.Client, error) {
+	var optFns []func(*config.LoadOptions) error
+	if region != "" {
+		optFns = append(optFns, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, optFns...)
+	if err != nil {
+		return nil, err
+	}
+
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL_S3")
+	}
+
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.EndpointResolver = s3.EndpointResolverFromURL(normalizeEndpoint(endpoint, disableSSL))
+			o.UsePathStyle = pathStyle
+			return
+		}
+		o.UsePathStyle = false
+		o.EndpointResolver = s3.EndpointResolverFromURL(
+			fmt.Sprintf("https://s3.dualstack.%s.amazonaws.com", cfg.Region),
+		)
+	}), nil
+}
+
+// normalizeEndpoint adds a scheme to a bare host:port endpoint, honoring
+// --disableSSL; an endpoint that already specifies a scheme is left as-is.
+func normalizeEndpoint(endpoint string, disableSSL bool) string {
+	if strings.Contains(endpoint, "://") {
+		return endpoint
+	}
+	scheme := "https"
+	if disableSSL {
+		scheme = "http"
+	}
+	return scheme + "://" + endpoint
+}
@@ -1,23 +1,262 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
 	"log"
+	"math/rand"
+	"net"
 	"net/url"
 	"os"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithy "github.com/aws/smithy-go"
 )
 
+const (
+	retryBaseDelay = 100 * time.Millisecond
+	retryCapDelay  = 20 * time.Second
+
+	// maxPartSize is S3's per-part size ceiling.
+	maxPartSize = 5 * 1024 * 1024 * 1024 // 5 GiB
+
+	// dynamicSizingStartPart is how many parts may be dispatched at the
+	// configured partSize before part size starts doubling, raising how much
+	// an unknown-length stream can send within S3's 10,000-part cap.
+	dynamicSizingStartPart = 1000
+)
+
+// calculatePartsCount returns the number of parts needed to cover inputSize
+// bytes at partSize bytes per part.
+func calculatePartsCount(inputSize int64, partSize int) int {
+	partsCount := int(inputSize / int64(partSize))
+	if inputSize%int64(partSize) != 0 {
+		partsCount++
+	}
+	return partsCount
+}
+
+// nextPartSize grows partSize for streaming uploads of unknown length: once
+// partNumber has passed nextDoubleAt, the part size doubles (capped at
+// maxPartSize) and nextDoubleAt is doubled alongside it, matching the
+// strategy used by rclone and the aws-sdk transfer managers. Starting from
+// dynamicSizingStartPart, 10,000 parts hold at most 75,000 times the starting
+// part size; a longer stream still runs past S3's 10,000-part limit.
+func nextPartSize(partSize int, partNumber int32, nextDoubleAt *int32) int {
+	if partSize >= maxPartSize {
+		return partSize
+	}
+	if partNumber <= *nextDoubleAt {
+		return partSize
+	}
+	partSize *= 2
+	if partSize > maxPartSize {
+		partSize = maxPartSize
+	}
+	*nextDoubleAt *= 2
+	return partSize
+}
+
+// metadataFlag collects repeated `--metadata key=value` flags into a map.
+type metadataFlag map[string]string
+
+func (m metadataFlag) String() string {
+	if m == nil {
+		return ""
+	}
+	parts := make([]string, 0, len(m))
+	for k, v := range m {
+		parts = append(parts, k+"="+v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (m metadataFlag) Set(value string) error {
+	k, v, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("invalid --metadata %q: expected key=value", value)
+	}
+	m[k] = v
+	return nil
+}
+
+// sseOptions holds the server-side encryption, storage class, and object
+// metadata settings shared between CreateMultipartUpload and every
+// UploadPart call (SSE-C requires the customer key be echoed on each part).
+type sseOptions struct {
+	sse                  types.ServerSideEncryption
+	sseKmsKeyID          string
+	storageClass         types.StorageClass
+	contentType          string
+	cacheControl         string
+	contentEncoding      string
+	metadata             map[string]string
+	sseCustomerAlgorithm string
+	sseCustomerKey       string
+	sseCustomerKeyMD5    string
+}
+
+// applyToCreateInput copies the configured encryption, storage class, and
+// metadata options onto a CreateMultipartUploadInput.
+func (o sseOptions) applyToCreateInput(input *s3.CreateMultipartUploadInput) {
+	if o.sse != "" {
+		input.ServerSideEncryption = o.sse
+		if o.sse == types.ServerSideEncryptionAwsKms && o.sseKmsKeyID != "" {
+			input.SSEKMSKeyId = &o.sseKmsKeyID
+		}
+	}
+	if o.storageClass != "" {
+		input.StorageClass = o.storageClass
+	}
+	if o.contentType != "" {
+		input.ContentType = &o.contentType
+	}
+	if o.cacheControl != "" {
+		input.CacheControl = &o.cacheControl
+	}
+	if o.contentEncoding != "" {
+		input.ContentEncoding = &o.contentEncoding
+	}
+	if len(o.metadata) > 0 {
+		input.Metadata = o.metadata
+	}
+	o.applySSECToInput(&input.SSECustomerAlgorithm, &input.SSECustomerKey, &input.SSECustomerKeyMD5)
+}
+
+// applyToUploadPartInput echoes the SSE-C customer key onto each UploadPart
+// call; S3 requires it match the key supplied at CreateMultipartUpload time.
+func (o sseOptions) applyToUploadPartInput(input *s3.UploadPartInput) {
+	o.applySSECToInput(&input.SSECustomerAlgorithm, &input.SSECustomerKey, &input.SSECustomerKeyMD5)
+}
+
+func (o sseOptions) applySSECToInput(algorithm, key, keyMD5 **string) {
+	if o.sseCustomerKey == "" {
+		return
+	}
+	*algorithm = &o.sseCustomerAlgorithm
+	*key = &o.sseCustomerKey
+	*keyMD5 = &o.sseCustomerKeyMD5
+}
+
+// partChecksum holds the locally-computed digests for one part: an MD5
+// (always, for multipart ETag verification) and, if --checksumAlgorithm is
+// set, the base64-encoded value to send on the wire and compare against
+// what S3 reports back.
+type partChecksum struct {
+	md5      [md5.Size]byte
+	b64      string
+	algoName string
+}
+
+func newCRC32CHash() hash.Hash32 {
+	return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+}
+
+// computePartChecksum hashes data with MD5 (always) and, if algo is
+// "SHA256" or "CRC32C", also with that algorithm, returning its
+// base64-encoded digest for use on UploadPartInput.
+func computePartChecksum(data []byte, algo string) (partChecksum, error) {
+	pc := partChecksum{md5: md5.Sum(data), algoName: algo}
+	switch algo {
+	case "":
+		return pc, nil
+	case "SHA256":
+		sum := sha256.Sum256(data)
+		pc.b64 = base64.StdEncoding.EncodeToString(sum[:])
+	case "CRC32C":
+		h := newCRC32CHash()
+		h.Write(data)
+		var sum [4]byte
+		h.Sum(sum[:0])
+		pc.b64 = base64.StdEncoding.EncodeToString(sum[:])
+	default:
+		return pc, fmt.Errorf("unsupported checksum algorithm %q", algo)
+	}
+	return pc, nil
+}
+
+// applyToUploadPartInput sets the part's checksum field matching algoName.
+func (pc partChecksum) applyToUploadPartInput(input *s3.UploadPartInput) {
+	switch pc.algoName {
+	case "SHA256":
+		input.ChecksumSHA256 = &pc.b64
+	case "CRC32C":
+		input.ChecksumCRC32C = &pc.b64
+	}
+}
+
+// applyToCompletedPart carries the sent checksum onto the CompletedPart
+// entry, which CompleteMultipartUpload validates against what it stored.
+func (pc partChecksum) applyToCompletedPart(part *types.CompletedPart) {
+	switch pc.algoName {
+	case "SHA256":
+		part.ChecksumSHA256 = &pc.b64
+	case "CRC32C":
+		part.ChecksumCRC32C = &pc.b64
+	}
+}
+
+// verifyUploadPartOutput confirms S3 echoed back the same checksum we sent.
+func (pc partChecksum) verifyUploadPartOutput(output *s3.UploadPartOutput) error {
+	switch pc.algoName {
+	case "SHA256":
+		if output.ChecksumSHA256 == nil || *output.ChecksumSHA256 != pc.b64 {
+			return fmt.Errorf("checksum mismatch: sent SHA256 %s, S3 reported %v", pc.b64, output.ChecksumSHA256)
+		}
+	case "CRC32C":
+		if output.ChecksumCRC32C == nil || *output.ChecksumCRC32C != pc.b64 {
+			return fmt.Errorf("checksum mismatch: sent CRC32C %s, S3 reported %v", pc.b64, output.ChecksumCRC32C)
+		}
+	}
+	return nil
+}
+
+// expectedMultipartETag reproduces S3's multipart ETag: the hex MD5 of the
+// concatenated per-part MD5 digests, suffixed with "-<part count>".
+func expectedMultipartETag(md5s [][md5.Size]byte) string {
+	concat := make([]byte, 0, len(md5s)*md5.Size)
+	for _, sum := range md5s {
+		concat = append(concat, sum[:]...)
+	}
+	overall := md5.Sum(concat)
+	return hex.EncodeToString(overall[:]) + "-" + strconv.Itoa(len(md5s))
+}
+
+// parseS3URIPrefix is like parseS3URI but allows an empty key, for
+// --listPending/--abortPending which operate on a bucket/prefix rather than
+// a single object.
+func parseS3URIPrefix(s3uri string) (bucket, prefix string, err error) {
+	if !strings.HasPrefix(s3uri, "s3://") {
+		return "", "", errors.New("invalid S3 URI: must start with s3://")
+	}
+	u, err := url.Parse(s3uri)
+	if err != nil {
+		return "", "", err
+	}
+	bucket = u.Host
+	if bucket == "" {
+		return "", "", errors.New("invalid S3 URI: missing bucket")
+	}
+	return bucket, strings.TrimPrefix(u.Path, "/"), nil
+}
+
 func parseS3URI(s3uri string) (bucket, key string, err error) {
 	if !strings.HasPrefix(s3uri, "s3://") {
 		return "", "", errors.New("invalid S3 URI: must start with s3://")
@@ -38,11 +277,14 @@ type partUpload struct {
 	partNumber int32
 	data       []byte
 	size       int
+	endOffset  int64 // cumulative input bytes read through the end of this part
 }
 
 type uploadResult struct {
-	part types.CompletedPart
-	err  error
+	part      types.CompletedPart
+	md5       [md5.Size]byte
+	endOffset int64
+	err       error
 }
 
 // Zero-allocation bytes reader that implements io.ReadSeeker
@@ -85,24 +327,138 @@ func (r *bytesReader) Seek(offset int64, whence int) (int64, error) {
 	return newPos, nil
 }
 
+// retryableAPICodes are the S3/Smithy error codes worth retrying; anything
+// else is treated as a permanent failure and fails fast.
+var retryableAPICodes = map[string]bool{
+	"RequestTimeout":     true,
+	"SlowDown":           true,
+	"InternalError":      true,
+	"ServiceUnavailable": true,
+}
+
+// isRetryableError reports whether err is transient and worth retrying:
+// a recognized S3 API error code, or a network-level error (timeout, reset,
+// EOF mid-read).
+func isRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return retryableAPICodes[apiErr.ErrorCode()]
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.ErrClosedPipe)
+}
+
+// backoffDelay returns the exponential-backoff-with-full-jitter delay for the
+// given zero-based attempt: sleep = rand(0, min(cap, base*2^attempt)).
+func backoffDelay(attempt int) time.Duration {
+	maxDelay := retryBaseDelay << attempt
+	if maxDelay <= 0 || maxDelay > retryCapDelay {
+		maxDelay = retryCapDelay
+	}
+	return time.Duration(rand.Int63n(int64(maxDelay)))
+}
+
+// uploadPartWithRetry uploads a single part, retrying transient failures up
+// to maxRetries times with exponential backoff and full jitter. reader is
+// rewound to the start before each attempt so the body can be replayed.
+func uploadPartWithRetry(ctx context.Context, client *s3.Client, input *s3.UploadPartInput, reader *bytesReader, maxRetries int) (*s3.UploadPartOutput, error) {
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			if _, err := reader.Seek(0, io.SeekStart); err != nil {
+				return nil, fmt.Errorf("failed to reset part body for retry: %w", err)
+			}
+			select {
+			case <-time.After(backoffDelay(attempt - 1)):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		output, err := client.UploadPart(ctx, input)
+		if err == nil {
+			return output, nil
+		}
+
+		lastErr = err
+		if !isRetryableError(err) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("upload part %d failed after %d attempts: %w", *input.PartNumber, maxRetries+1, lastErr)
+}
+
 func main() {
 	// Parse command line flags
 	partSizeMB := flag.Int("partSize", 5, "Part size in MB for multipart upload (min 5MB)")
-	inputSize := flag.Int64("inputSize", 0, "Exact input size in bytes (required)")
+	inputSize := flag.Int64("inputSize", 0, "Exact input size in bytes (omit to stream stdin of unknown length)")
 	concurrency := flag.Int("concurrency", 1, "Number of concurrent part uploads")
+	maxRetries := flag.Int("maxRetries", 3, "Maximum number of retries per part on transient errors")
+	sse := flag.String("sse", "", "Server-side encryption mode (AES256|aws:kms)")
+	sseKmsKeyID := flag.String("sseKmsKeyId", "", "KMS key ID/ARN to use when --sse=aws:kms")
+	storageClass := flag.String("storageClass", "", "Object storage class (STANDARD|STANDARD_IA|INTELLIGENT_TIERING|GLACIER|DEEP_ARCHIVE)")
+	contentType := flag.String("contentType", "", "Content-Type to set on the object")
+	cacheControl := flag.String("cacheControl", "", "Cache-Control to set on the object")
+	contentEncoding := flag.String("contentEncoding", "", "Content-Encoding to set on the object")
+	sseCustomerKey := flag.String("sseCustomerKey", "", "Base64-encoded SSE-C customer-provided encryption key")
+	sseCustomerKeyMD5 := flag.String("sseCustomerKeyMD5", "", "Base64-encoded MD5 digest of the SSE-C customer key")
+	metadata := make(metadataFlag)
+	flag.Var(metadata, "metadata", "Object metadata as key=value (repeatable)")
+	checksumAlgorithm := flag.String("checksumAlgorithm", "", "Per-part checksum algorithm to compute and verify (SHA256|CRC32C)")
+	fullObjectChecksum := flag.Bool("fullObjectChecksum", false, "Log a rolling SHA-256 of the entire input for out-of-band end-to-end verification")
+	stateFile := flag.String("stateFile", "", "Path to a JSON state file for resuming an interrupted upload")
+	listPending := flag.Bool("listPending", false, "List in-progress multipart uploads for the given s3://bucket/prefix and exit")
+	abortPending := flag.Bool("abortPending", false, "Abort in-progress multipart uploads older than --olderThan for s3://bucket/prefix and exit")
+	olderThan := flag.Duration("olderThan", 24*time.Hour, "Minimum age for --abortPending to consider an upload stale")
+	maxMemoryMB := flag.Int("maxMemoryMB", 0, "Hard cap on in-flight part memory in MB (default partSize*concurrency*2)")
+	useMmap := flag.Bool("useMmap", false, "Back part buffers with anonymous mmap pages instead of the Go heap")
+	readBufferSize := flag.Int("readBufferSize", 1024*1024, "Buffer size in bytes for individual reads from stdin")
+	endpoint := flag.String("endpoint", "", "S3-compatible endpoint URL (also read from AWS_ENDPOINT_URL_S3); unset uses AWS's dualstack endpoint")
+	region := flag.String("region", "", "AWS region, or the region your S3-compatible provider expects")
+	pathStyle := flag.Bool("pathStyle", false, "Use path-style addressing (required by most S3-compatible providers)")
+	disableSSL := flag.Bool("disableSSL", false, "Use http:// instead of https:// when --endpoint has no scheme")
 	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [--partSize=MB] [--inputSize=bytes] [--concurrency=N] s3://bucket/key\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] s3://bucket/key\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 
+	if *listPending || *abortPending {
+		bucket, prefix, err := parseS3URIPrefix(flag.Arg(0))
+		if err != nil {
+			log.Fatalf("Error parsing S3 URI: %v", err)
+		}
+		ctx := context.Background()
+		client, err := newS3Client(ctx, *region, *endpoint, *pathStyle, *disableSSL)
+		if err != nil {
+			log.Fatalf("Error loading AWS config: %v", err)
+		}
+		if *listPending {
+			if err := listPendingUploads(ctx, client, bucket, prefix); err != nil {
+				log.Fatalf("%v", err)
+			}
+		} else {
+			if err := abortPendingUploads(ctx, client, bucket, prefix, *olderThan); err != nil {
+				log.Fatalf("%v", err)
+			}
+		}
+		return
+	}
+
 	// Validate arguments
 	if *partSizeMB < 5 {
 		log.Fatalf("partSize must be at least 5MB")
 	}
-	if *inputSize <= 0 {
-		log.Fatalf("inputSize must be a positive integer")
+	if *inputSize < 0 {
+		log.Fatalf("inputSize must not be negative")
 	}
+	knownSize := *inputSize > 0
 	if flag.NArg() != 1 {
 		flag.Usage()
 		os.Exit(1)
@@ -110,6 +466,30 @@ func main() {
 	if *concurrency < 1 {
 		*concurrency = 1
 	}
+	if *sseCustomerKey != "" && *sse != "" {
+		log.Fatalf("--sseCustomerKey cannot be combined with --sse (SSE-C and SSE-S3/KMS are mutually exclusive)")
+	}
+	switch *checksumAlgorithm {
+	case "", "SHA256", "CRC32C":
+	default:
+		log.Fatalf("checksumAlgorithm must be SHA256 or CRC32C")
+	}
+
+	opts := sseOptions{
+		sse:                  types.ServerSideEncryption(*sse),
+		sseKmsKeyID:          *sseKmsKeyID,
+		storageClass:         types.StorageClass(*storageClass),
+		contentType:          *contentType,
+		cacheControl:         *cacheControl,
+		contentEncoding:      *contentEncoding,
+		metadata:             metadata,
+		sseCustomerAlgorithm: "",
+		sseCustomerKey:       *sseCustomerKey,
+		sseCustomerKeyMD5:    *sseCustomerKeyMD5,
+	}
+	if opts.sseCustomerKey != "" {
+		opts.sseCustomerAlgorithm = "AES256"
+	}
 
 	// Parse S3 URI
 	s3uri := flag.Arg(0)
@@ -120,47 +500,94 @@ func main() {
 
 	// Initialize AWS client
 	ctx := context.Background()
-	cfg, err := config.LoadDefaultConfig(ctx)
+	client, err := newS3Client(ctx, *region, *endpoint, *pathStyle, *disableSSL)
 	if err != nil {
 		log.Fatalf("Error loading AWS config: %v", err)
 	}
 
-	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
-		o.UsePathStyle = false
-		o.EndpointResolver = s3.EndpointResolverFromURL(
-			fmt.Sprintf("https://s3.dualstack.%s.amazonaws.com", cfg.Region),
-		)
-	})
-
 	partSize := *partSizeMB * 1024 * 1024
 
-	// Calculate exact number of parts needed
-	partsCount := int(*inputSize / int64(partSize))
-	if *inputSize%int64(partSize) != 0 {
-		partsCount++
+	if *maxMemoryMB <= 0 {
+		*maxMemoryMB = *partSizeMB * *concurrency * 2
 	}
 
-	log.Printf("Starting upload: %d parts, %d MB each, %d concurrent workers", 
-		partsCount, *partSizeMB, *concurrency)
+	if knownSize {
+		partsCount := calculatePartsCount(*inputSize, partSize)
+		log.Printf("Starting upload: %d parts, %d MB each, %d concurrent workers",
+			partsCount, *partSizeMB, *concurrency)
+	} else {
+		log.Printf("Starting streaming upload: %d MB parts (growing after part %d), %d concurrent workers",
+			*partSizeMB, dynamicSizingStartPart, *concurrency)
+	}
 
-	// Start multipart upload
-	createOutput, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
-		Bucket: &bucket,
-		Key:    &key,
-	})
-	if err != nil {
-		log.Fatalf("Failed to initiate multipart upload: %v", err)
+	// Resume from a state file if one was given and matches this target, or
+	// start a fresh multipart upload (and state, if --stateFile is set).
+	var uploadID *string
+	var resumeResults []uploadResult
+	var resumeOffset int64
+	haveAllResumedMD5s := true
+	var state *uploadState
+
+	if *stateFile != "" {
+		loaded, err := loadUploadState(*stateFile)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if loaded != nil && loaded.Bucket == bucket && loaded.Key == key && loaded.PartSize == partSize {
+			log.Printf("Resuming upload %s from state file %s", loaded.UploadID, *stateFile)
+			var retained []completedPartState
+			resumeResults, retained, resumeOffset, haveAllResumedMD5s, err = reconcileState(ctx, client, bucket, key, loaded.UploadID, loaded.CompletedParts)
+			if err != nil {
+				log.Fatalf("Failed to reconcile state file against S3: %v", err)
+			}
+			state = loaded
+			state.CompletedParts = retained
+			if err := state.save(*stateFile); err != nil {
+				log.Fatalf("Failed to write reconciled state file: %v", err)
+			}
+			uploadID = &state.UploadID
+		}
 	}
-	uploadID := createOutput.UploadId
 
-	// Memory-efficient buffer pool - only allocate what we need
-	bufferPool := &sync.Pool{
-		New: func() interface{} {
-			buf := make([]byte, partSize)
-			return &buf
-		},
+	if uploadID == nil {
+		createInput := &s3.CreateMultipartUploadInput{
+			Bucket: &bucket,
+			Key:    &key,
+		}
+		opts.applyToCreateInput(createInput)
+		switch *checksumAlgorithm {
+		case "SHA256":
+			createInput.ChecksumAlgorithm = types.ChecksumAlgorithmSha256
+		case "CRC32C":
+			createInput.ChecksumAlgorithm = types.ChecksumAlgorithmCrc32c
+		}
+		createOutput, err := client.CreateMultipartUpload(ctx, createInput)
+		if err != nil {
+			log.Fatalf("Failed to initiate multipart upload: %v", err)
+		}
+		uploadID = createOutput.UploadId
+		if *stateFile != "" {
+			state = newUploadState(bucket, key, *uploadID, partSize)
+			if err := state.save(*stateFile); err != nil {
+				log.Fatalf("Failed to write state file: %v", err)
+			}
+		}
+	}
+
+	if resumeOffset > 0 {
+		if *fullObjectChecksum {
+			log.Fatalf("--fullObjectChecksum cannot be combined with resuming a partially-uploaded object: the skipped prefix is never hashed, so the logged digest would not cover the whole object")
+		}
+		if _, err := os.Stdin.Seek(resumeOffset, io.SeekStart); err != nil {
+			log.Fatalf("Cannot resume: stdin is not seekable (%v) - re-run from the start, or redirect a seekable file", err)
+		}
+		log.Printf("Skipped %d already-uploaded bytes", resumeOffset)
 	}
 
+	// Bounded buffer pool - caps in-flight part memory at maxMemoryMB and
+	// blocks the stdin reader once that cap is hit
+	bufferPool := newBufferPool(partSize, int64(*maxMemoryMB)*1024*1024, *useMmap)
+
 	// Channels for coordination
 	partsChan := make(chan partUpload, *concurrency)
 	resultsChan := make(chan uploadResult, *concurrency)
@@ -179,7 +606,17 @@ func main() {
 			for part := range partsChan {
 				// Create reader from the part data
 				reader := newBytesReader(part.data[:part.size])
-				
+
+				pc, err := computePartChecksum(part.data[:part.size], *checksumAlgorithm)
+				if err != nil {
+					bufferPool.put(part.data)
+					select {
+					case resultsChan <- uploadResult{err: err}:
+					case <-ctx.Done():
+					}
+					continue
+				}
+
 				// Upload the part
 				uploadInput := &s3.UploadPartInput{
 					Bucket:     &bucket,
@@ -188,22 +625,27 @@ func main() {
 					PartNumber: &part.partNumber,
 					Body:       reader,
 				}
-				
-				result := uploadResult{}
-				uploadOutput, err := client.UploadPart(ctx, uploadInput)
-				
+				opts.applyToUploadPartInput(uploadInput)
+				pc.applyToUploadPartInput(uploadInput)
+
+				result := uploadResult{md5: pc.md5, endOffset: part.endOffset}
+				uploadOutput, err := uploadPartWithRetry(ctx, client, uploadInput, reader, *maxRetries)
+
 				// Return buffer to pool immediately after upload
-				bufferPool.Put(&part.data)
-				
+				bufferPool.put(part.data)
+
 				if err != nil {
 					result.err = err
+				} else if err := pc.verifyUploadPartOutput(uploadOutput); err != nil {
+					result.err = err
 				} else {
 					result.part = types.CompletedPart{
 						ETag:       uploadOutput.ETag,
 						PartNumber: &part.partNumber,
 					}
+					pc.applyToCompletedPart(&result.part)
 				}
-				
+
 				// Send result back
 				select {
 				case resultsChan <- result:
@@ -214,106 +656,165 @@ func main() {
 		}(i)
 	}
 
-	// Start result collector goroutine
-	completedParts := make([]types.CompletedPart, partsCount)
+	// Start result collector goroutine. The number of parts isn't known up
+	// front in streaming mode, so the collector just drains resultsChan
+	// until it's closed (after all workers finish) rather than counting
+	// down a fixed partsCount.
+	completedResults := append([]uploadResult{}, resumeResults...)
 	var collectorWG sync.WaitGroup
 	var uploadError error
-	
+
 	collectorWG.Add(1)
 	go func() {
 		defer collectorWG.Done()
-		
-		for i := 0; i < partsCount; i++ {
-			select {
-			case result := <-resultsChan:
-				if result.err != nil {
+
+		for result := range resultsChan {
+			if result.err != nil {
+				if uploadError == nil {
 					uploadError = result.err
-					cancel() // Cancel all workers
-					return
 				}
-				// Store completed part in correct position
-				idx := int(*result.part.PartNumber) - 1
-				if idx >= 0 && idx < len(completedParts) {
-					completedParts[idx] = result.part
+				cancel() // Cancel all workers
+				continue
+			}
+			completedResults = append(completedResults, result)
+			if state != nil {
+				partState := completedPartState{
+					PartNumber: *result.part.PartNumber,
+					ETag:       *result.part.ETag,
+					Checksum:   hex.EncodeToString(result.md5[:]),
+					Offset:     result.endOffset,
+				}
+				if err := state.recordPart(*stateFile, partState); err != nil {
+					log.Printf("Warning: failed to persist state file: %v", err)
 				}
-			case <-ctx.Done():
-				return
 			}
 		}
 	}()
 
-	// Read data from stdin and dispatch to workers
-	var partNumber int32 = 1
+	// Read data from stdin and dispatch to workers. stdinReader caps each
+	// individual syscall to readBufferSize rather than asking for a whole
+	// part in one read, which keeps tail latency down when stdin is slow.
+	stdinReader := bufio.NewReaderSize(os.Stdin, *readBufferSize)
+	partNumber := int32(len(resumeResults)) + 1
+	totalRead := resumeOffset
 	var readError error
-	
-	for partNumber <= int32(partsCount) {
-		// Get buffer from pool
-		bufPtr := bufferPool.Get().(*[]byte)
-		buf := *bufPtr
-		
+	currentPartSize := partSize
+	nextDoubleAt := int32(dynamicSizingStartPart)
+	var fullChecksum hash.Hash = sha256.New()
+
+readLoop:
+	for {
+		if knownSize && totalRead >= *inputSize {
+			break
+		}
+		if !knownSize {
+			currentPartSize = nextPartSize(currentPartSize, partNumber, &nextDoubleAt)
+		}
+
+		// Get a buffer from the bounded pool; blocks here once maxMemoryMB
+		// of parts are already in flight
+		buf, err := bufferPool.get(currentPartSize)
+		if err != nil {
+			readError = fmt.Errorf("failed to allocate buffer for part %d: %w", partNumber, err)
+			break
+		}
+
 		// Calculate how much to read for this part
-		remainingBytes := *inputSize - int64(partNumber-1)*int64(partSize)
-		readSize := int64(partSize)
-		if remainingBytes < readSize {
-			readSize = remainingBytes
+		readSize := int64(currentPartSize)
+		if knownSize {
+			remainingBytes := *inputSize - totalRead
+			if remainingBytes < readSize {
+				readSize = remainingBytes
+			}
+		}
+
+		// Read data from stdin, at most readBufferSize bytes per call, until
+		// the part is full or stdin hits EOF
+		var n int
+		for n < int(readSize) && err == nil {
+			end := n + stdinReader.Size()
+			if end > int(readSize) {
+				end = int(readSize)
+			}
+			var m int
+			m, err = stdinReader.Read(buf[n:end])
+			n += m
 		}
-		
-		// Read data from stdin
-		n, err := io.ReadFull(os.Stdin, buf[:readSize])
 		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
-			bufferPool.Put(bufPtr) // Return buffer on error
+			bufferPool.put(buf) // Return buffer on error
 			readError = fmt.Errorf("failed to read part %d: %w", partNumber, err)
 			break
 		}
-		
+
 		if n == 0 {
-			bufferPool.Put(bufPtr) // Return buffer if no data read
+			bufferPool.put(buf) // Return buffer if no data read
 			break
 		}
-		
+		totalRead += int64(n)
+		if *fullObjectChecksum {
+			fullChecksum.Write(buf[:n])
+		}
+
 		// Create upload task
 		task := partUpload{
 			partNumber: partNumber,
 			data:       buf,
 			size:       n,
+			endOffset:  totalRead,
 		}
-		
+
 		// Send to workers (this will block if all workers are busy)
 		select {
 		case partsChan <- task:
 			// Task dispatched successfully
 		case <-ctx.Done():
-			bufferPool.Put(bufPtr)
-			break
+			// An upload failed and cancelled ctx - stop reading stdin
+			// immediately instead of draining the rest of the input (which,
+			// for a never-closing pipe like pg_dump|tar|zstd, would hang
+			// forever).
+			bufferPool.put(buf)
+			break readLoop
 		}
-		
+
 		partNumber++
-		
+
 		if err == io.EOF || err == io.ErrUnexpectedEOF {
 			break
 		}
 	}
-	
+
 	// Close parts channel and wait for workers to finish
 	close(partsChan)
 	workerWG.Wait()
-	
-	// Wait for result collector to finish
+
+	// All workers are done producing, so it's safe to close resultsChan and
+	// let the collector drain whatever's left.
+	close(resultsChan)
 	collectorWG.Wait()
-	
+
 	// Check for errors
 	if readError != nil {
-		abortMultipart(ctx, client, bucket, key, uploadID)
+		abortMultipart(client, bucket, key, uploadID)
 		log.Fatalf("Read error: %v", readError)
 	}
-	
+
 	if uploadError != nil {
-		abortMultipart(ctx, client, bucket, key, uploadID)
+		abortMultipart(client, bucket, key, uploadID)
 		log.Fatalf("Upload error: %v", uploadError)
 	}
-	
+
+	sort.Slice(completedResults, func(i, j int) bool {
+		return *completedResults[i].part.PartNumber < *completedResults[j].part.PartNumber
+	})
+	completedParts := make([]types.CompletedPart, len(completedResults))
+	partMD5s := make([][md5.Size]byte, len(completedResults))
+	for i, result := range completedResults {
+		completedParts[i] = result.part
+		partMD5s[i] = result.md5
+	}
+
 	// Complete the multipart upload
-	_, err = client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+	completeOutput, err := client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
 		Bucket:   &bucket,
 		Key:      &key,
 		UploadId: uploadID,
@@ -322,17 +823,39 @@ func main() {
 		},
 	})
 	if err != nil {
-		abortMultipart(ctx, client, bucket, key, uploadID)
+		abortMultipart(client, bucket, key, uploadID)
 		log.Fatalf("Failed to complete multipart upload: %v", err)
 	}
-	
+
+	if opts.sse == "" && opts.sseCustomerKey == "" && haveAllResumedMD5s {
+		if completeOutput.ETag == nil {
+			log.Fatalf("ETag verification failed: S3 did not return an ETag for the completed object")
+		}
+		want := expectedMultipartETag(partMD5s)
+		got := strings.Trim(*completeOutput.ETag, `"`)
+		if got != want {
+			log.Fatalf("ETag mismatch after completion: expected %s, got %s (object may be corrupt)", want, got)
+		}
+	}
+
+	if *fullObjectChecksum {
+		log.Printf("Full object SHA-256: %x", fullChecksum.Sum(nil))
+	}
+
 	// Force garbage collection to free any remaining memory
 	runtime.GC()
-	
+
 	log.Println("Upload completed successfully.")
 }
 
-func abortMultipart(ctx context.Context, client *s3.Client, bucket, key string, uploadID *string) {
+// abortMultipart always aborts on a fresh context rather than the caller's:
+// it's invoked after an upload failure, by which point the upload's own ctx
+// is typically already cancelled, and an AbortMultipartUpload call made on a
+// cancelled context never reaches S3 - silently orphaning the multipart
+// upload for --abortPending to clean up later instead of here.
+func abortMultipart(client *s3.Client, bucket, key string, uploadID *string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 	_, err := client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
 		Bucket:   &bucket,
 		Key:      &key,
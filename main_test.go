@@ -1,6 +1,27 @@
 package main
 
-import "testing"
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	smithy "github.com/aws/smithy-go"
+)
+
+type fakeAPIError struct {
+	code string
+}
+
+func (e fakeAPIError) Error() string        { return e.code }
+func (e fakeAPIError) ErrorCode() string    { return e.code }
+func (e fakeAPIError) ErrorMessage() string { return e.code }
+func (e fakeAPIError) ErrorFault() smithy.ErrorFault {
+	return smithy.FaultUnknown
+}
 
 func TestParseS3URI(t *testing.T) {
 	tests := []struct {
@@ -105,3 +126,234 @@ func TestCalculatePartsCount(t *testing.T) {
 		})
 	}
 }
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"retryable API code", fakeAPIError{code: "SlowDown"}, true},
+		{"another retryable API code", fakeAPIError{code: "RequestTimeout"}, true},
+		{"permanent API code", fakeAPIError{code: "AccessDenied"}, false},
+		{"network error", &net.DNSError{IsTimeout: true}, true},
+		{"EOF", io.EOF, true},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"closed pipe", io.ErrClosedPipe, true},
+		{"unrelated error", errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableError(tt.err); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		attempt int
+		cap     time.Duration
+	}{
+		{"first attempt", 0, retryBaseDelay},
+		{"grows with attempt", 3, retryBaseDelay << 3},
+		{"clamped past cap", 20, retryCapDelay},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 50; i++ {
+				d := backoffDelay(tt.attempt)
+				if d < 0 || d > tt.cap {
+					t.Fatalf("backoffDelay(%d) = %v, want within [0, %v]", tt.attempt, d, tt.cap)
+				}
+			}
+		})
+	}
+}
+
+func TestNextPartSize(t *testing.T) {
+	tests := []struct {
+		name           string
+		partSize       int
+		partNumber     int32
+		nextDoubleAt   int32
+		wantSize       int
+		wantNextDouble int32
+	}{
+		{
+			name:           "below threshold stays the same",
+			partSize:       5 * 1024 * 1024,
+			partNumber:     500,
+			nextDoubleAt:   dynamicSizingStartPart,
+			wantSize:       5 * 1024 * 1024,
+			wantNextDouble: dynamicSizingStartPart,
+		},
+		{
+			name:           "at threshold stays the same",
+			partSize:       5 * 1024 * 1024,
+			partNumber:     dynamicSizingStartPart,
+			nextDoubleAt:   dynamicSizingStartPart,
+			wantSize:       5 * 1024 * 1024,
+			wantNextDouble: dynamicSizingStartPart,
+		},
+		{
+			name:           "past threshold doubles and advances the next threshold",
+			partSize:       5 * 1024 * 1024,
+			partNumber:     dynamicSizingStartPart + 1,
+			nextDoubleAt:   dynamicSizingStartPart,
+			wantSize:       10 * 1024 * 1024,
+			wantNextDouble: dynamicSizingStartPart * 2,
+		},
+		{
+			name:           "doubling caps at maxPartSize",
+			partSize:       maxPartSize - 1,
+			partNumber:     dynamicSizingStartPart + 1,
+			nextDoubleAt:   dynamicSizingStartPart,
+			wantSize:       maxPartSize,
+			wantNextDouble: dynamicSizingStartPart * 2,
+		},
+		{
+			name:           "already at maxPartSize is a no-op",
+			partSize:       maxPartSize,
+			partNumber:     dynamicSizingStartPart + 1,
+			nextDoubleAt:   dynamicSizingStartPart,
+			wantSize:       maxPartSize,
+			wantNextDouble: dynamicSizingStartPart,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nextDoubleAt := tt.nextDoubleAt
+			got := nextPartSize(tt.partSize, tt.partNumber, &nextDoubleAt)
+			if got != tt.wantSize {
+				t.Fatalf("got size %d, want %d", got, tt.wantSize)
+			}
+			if nextDoubleAt != tt.wantNextDouble {
+				t.Fatalf("got nextDoubleAt %d, want %d", nextDoubleAt, tt.wantNextDouble)
+			}
+		})
+	}
+}
+
+func TestExpectedMultipartETag(t *testing.T) {
+	part1 := md5.Sum([]byte("part one"))
+	part2 := md5.Sum([]byte("part two"))
+
+	tests := []struct {
+		name string
+		md5s [][md5.Size]byte
+		want string
+	}{
+		{
+			name: "single part",
+			md5s: [][md5.Size]byte{part1},
+			want: hex.EncodeToString(md5.Sum(part1[:])[:]) + "-1",
+		},
+		{
+			name: "two parts",
+			md5s: [][md5.Size]byte{part1, part2},
+			want: hex.EncodeToString(md5.Sum(append(append([]byte{}, part1[:]...), part2[:]...))[:]) + "-2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expectedMultipartETag(tt.md5s); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputePartChecksum(t *testing.T) {
+	data := []byte("hello world")
+	wantMD5 := md5.Sum(data)
+
+	t.Run("no algorithm still computes MD5", func(t *testing.T) {
+		pc, err := computePartChecksum(data, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if pc.md5 != wantMD5 {
+			t.Fatalf("got md5 %x, want %x", pc.md5, wantMD5)
+		}
+		if pc.b64 != "" {
+			t.Fatalf("got b64 %q, want empty", pc.b64)
+		}
+	})
+
+	t.Run("SHA256 sets b64 and algoName", func(t *testing.T) {
+		pc, err := computePartChecksum(data, "SHA256")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if pc.md5 != wantMD5 {
+			t.Fatalf("got md5 %x, want %x", pc.md5, wantMD5)
+		}
+		if pc.algoName != "SHA256" || pc.b64 == "" {
+			t.Fatalf("got algoName %q b64 %q, want SHA256 and non-empty", pc.algoName, pc.b64)
+		}
+	})
+
+	t.Run("CRC32C sets b64 and algoName", func(t *testing.T) {
+		pc, err := computePartChecksum(data, "CRC32C")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if pc.algoName != "CRC32C" || pc.b64 == "" {
+			t.Fatalf("got algoName %q b64 %q, want CRC32C and non-empty", pc.algoName, pc.b64)
+		}
+	})
+
+	t.Run("unsupported algorithm errors", func(t *testing.T) {
+		if _, err := computePartChecksum(data, "MD5"); err == nil {
+			t.Fatalf("expected error for unsupported algorithm")
+		}
+	})
+}
+
+func TestNormalizeEndpoint(t *testing.T) {
+	tests := []struct {
+		name       string
+		endpoint   string
+		disableSSL bool
+		want       string
+	}{
+		{
+			name:     "bare host gets https",
+			endpoint: "minio.example.com:9000",
+			want:     "https://minio.example.com:9000",
+		},
+		{
+			name:       "bare host with disableSSL gets http",
+			endpoint:   "minio.example.com:9000",
+			disableSSL: true,
+			want:       "http://minio.example.com:9000",
+		},
+		{
+			name:     "scheme already present is left alone",
+			endpoint: "https://s3.eu-central-003.backblazeb2.com",
+			want:     "https://s3.eu-central-003.backblazeb2.com",
+		},
+		{
+			name:       "scheme already present ignores disableSSL",
+			endpoint:   "http://localhost:9000",
+			disableSSL: true,
+			want:       "http://localhost:9000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeEndpoint(tt.endpoint, tt.disableSSL); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// completedPartState is one entry of uploadState.CompletedParts, persisted
+// to the state file after every successful UploadPart so an upload can be
+// resumed after a crash.
+type completedPartState struct {
+	PartNumber int32  `json:"partNumber"`
+	ETag       string `json:"etag"`
+	Checksum   string `json:"checksum,omitempty"`
+	Offset     int64  `json:"offset"`
+}
+
+// uploadState is the on-disk shape of --stateFile: everything needed to
+// resume an in-flight multipart upload against the same s3 URI.
+type uploadState struct {
+	Bucket         string               `json:"bucket"`
+	Key            string               `json:"key"`
+	UploadID       string               `json:"uploadId"`
+	PartSize       int                  `json:"partSize"`
+	CompletedParts []completedPartState `json:"completedParts"`
+}
+
+func newUploadState(bucket, key, uploadID string, partSize int) *uploadState {
+	return &uploadState{Bucket: bucket, Key: key, UploadID: uploadID, PartSize: partSize}
+}
+
+// loadUploadState reads a state file written by a previous run. A missing
+// file is not an error: it just means this is a fresh upload.
+func loadUploadState(path string) (*uploadState, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+	var s uploadState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// save writes the state file atomically (write to a temp file, then rename)
+// so a crash mid-write can never leave a corrupt state file behind.
+func (s *uploadState) save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// recordPart appends a completed part and persists the state file.
+func (s *uploadState) recordPart(path string, part completedPartState) error {
+	s.CompletedParts = append(s.CompletedParts, part)
+	return s.save(path)
+}
+
+// listAllParts pages through ListParts for uploadID and returns every part
+// S3 has actually committed, sorted by part number.
+func listAllParts(ctx context.Context, client *s3.Client, bucket, key, uploadID string) ([]types.Part, error) {
+	var parts []types.Part
+	var partNumberMarker *string
+	for {
+		output, err := client.ListParts(ctx, &s3.ListPartsInput{
+			Bucket:           &bucket,
+			Key:              &key,
+			UploadId:         &uploadID,
+			PartNumberMarker: partNumberMarker,
+		})
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, output.Parts...)
+		if output.IsTruncated == nil || !*output.IsTruncated {
+			break
+		}
+		partNumberMarker = output.NextPartNumberMarker
+	}
+	sort.Slice(parts, func(i, j int) bool { return *parts[i].PartNumber < *parts[j].PartNumber })
+	return parts, nil
+}
+
+// reconcileState cross-checks the locally-recorded completed parts against
+// what S3 reports via ListParts (the authority on what's actually durable),
+// keeping only the contiguous prefix starting at part 1 that both sides
+// agree on. Local entries are persisted in completion order, which with
+// --concurrency>1 is neither sorted nor gap-free (a crash can leave e.g.
+// parts [1,5] recorded with 2-4 still in flight), so sorting and stopping at
+// the first gap - not just the first ETag mismatch - is required to avoid
+// resuming from a part number or offset that doesn't reflect a real prefix
+// of the upload. It returns the resumable uploadResults, the retained
+// (sorted, trimmed) local entries for persisting back to the state file, the
+// number of input bytes already uploaded, and whether every retained part
+// carried a local MD5 we can use to verify the final ETag.
+func reconcileState(ctx context.Context, client *s3.Client, bucket, key, uploadID string, local []completedPartState) (results []uploadResult, retained []completedPartState, resumeOffset int64, haveAllMD5s bool, err error) {
+	remoteParts, err := listAllParts(ctx, client, bucket, key, uploadID)
+	if err != nil {
+		return nil, nil, 0, false, fmt.Errorf("failed to list existing parts: %w", err)
+	}
+	remoteByNumber := make(map[int32]types.Part, len(remoteParts))
+	for _, p := range remoteParts {
+		remoteByNumber[*p.PartNumber] = p
+	}
+
+	sorted := append([]completedPartState{}, local...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].PartNumber < sorted[j].PartNumber })
+
+	haveAllMD5s = true
+	expected := int32(1)
+	for _, lp := range sorted {
+		if lp.PartNumber != expected {
+			// A gap (or duplicate) in the locally-recorded parts - the
+			// contiguous prefix ends here regardless of what comes after.
+			break
+		}
+		rp, ok := remoteByNumber[lp.PartNumber]
+		if !ok || rp.ETag == nil || *rp.ETag != lp.ETag {
+			// S3 and the state file disagree (or this part never actually
+			// committed) - stop here and re-upload from this part onward.
+			break
+		}
+		var md5Sum [md5.Size]byte
+		if lp.Checksum == "" {
+			haveAllMD5s = false
+		} else if decoded, decErr := hex.DecodeString(lp.Checksum); decErr == nil && len(decoded) == md5.Size {
+			copy(md5Sum[:], decoded)
+		} else {
+			haveAllMD5s = false
+		}
+		results = append(results, uploadResult{
+			part: types.CompletedPart{ETag: rp.ETag, PartNumber: rp.PartNumber},
+			md5:  md5Sum,
+		})
+		retained = append(retained, lp)
+		resumeOffset = lp.Offset
+		expected++
+	}
+	return results, retained, resumeOffset, haveAllMD5s, nil
+}
+
+// listPendingUploads prints every in-progress multipart upload under
+// bucket/prefix, for operators auditing what's still consuming storage.
+func listPendingUploads(ctx context.Context, client *s3.Client, bucket, prefix string) error {
+	var keyMarker, uploadIDMarker *string
+	for {
+		output, err := client.ListMultipartUploads(ctx, &s3.ListMultipartUploadsInput{
+			Bucket:         &bucket,
+			Prefix:         &prefix,
+			KeyMarker:      keyMarker,
+			UploadIdMarker: uploadIDMarker,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list multipart uploads: %w", err)
+		}
+		for _, u := range output.Uploads {
+			fmt.Printf("%s\t%s\t%s\n", *u.Key, *u.UploadId, u.Initiated.Format(time.RFC3339))
+		}
+		if output.IsTruncated == nil || !*output.IsTruncated {
+			return nil
+		}
+		keyMarker = output.NextKeyMarker
+		uploadIDMarker = output.NextUploadIdMarker
+	}
+}
+
+// abortPendingUploads aborts every multipart upload under bucket/prefix
+// initiated more than olderThan ago, reclaiming storage from uploads that
+// were never completed (e.g. killed mid-flight).
+func abortPendingUploads(ctx context.Context, client *s3.Client, bucket, prefix string, olderThan time.Duration) error {
+	cutoff := time.Now().Add(-olderThan)
+	var keyMarker, uploadIDMarker *string
+	for {
+		output, err := client.ListMultipartUploads(ctx, &s3.ListMultipartUploadsInput{
+			Bucket:         &bucket,
+			Prefix:         &prefix,
+			KeyMarker:      keyMarker,
+			UploadIdMarker: uploadIDMarker,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list multipart uploads: %w", err)
+		}
+		for _, u := range output.Uploads {
+			if u.Initiated == nil || u.Initiated.After(cutoff) {
+				continue
+			}
+			if _, err := client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+				Bucket:   &bucket,
+				Key:      u.Key,
+				UploadId: u.UploadId,
+			}); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to abort %s (upload %s): %v\n", *u.Key, *u.UploadId, err)
+				continue
+			}
+			fmt.Printf("aborted %s\t%s\t%s\n", *u.Key, *u.UploadId, u.Initiated.Format(time.RFC3339))
+		}
+		if output.IsTruncated == nil || !*output.IsTruncated {
+			return nil
+		}
+		keyMarker = output.NextKeyMarker
+		uploadIDMarker = output.NextUploadIdMarker
+	}
+}